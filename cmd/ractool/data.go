@@ -31,23 +31,23 @@ Usage:
 If no input_filename is given, stdin is used. Either way, output is written to
 stdout.
 
-The flags should include exactly one of -decode or -encode.
+The flags should include exactly one of -decode, -encode or -train.
 
-By default, a RAC file's chunks are decoded in parallel, using more total CPU
-time to substantially reduce the real (wall clock) time taken. Batch (instead
-of interactive) processing of many RAC files may want to pass -singlethreaded
-to prefer minimizing total CPU time.
+-train builds a zstd dictionary natively, without shelling out to
+"zstd --train":
+
+    ractool -train -samples=dir -maxdict=32k -o dict.dat
 
 When encoding, the input is partitioned into chunks and each chunk is
 compressed independently. You can specify the target chunk size in terms of
 either its compressed size or decompressed size. By default (if both
 -cchunksize and -dchunksize are zero), a 64KiB -dchunksize is used.
 
-You can also specify a -cpagesize, which is similar to but not exactly the same
-concept as alignment. If non-zero, padding is inserted into the output to
-minimize the number of pages that each chunk occupies. Look for "CPageSize" in
-the "package rac" documentation for more details:
-https://godoc.org/github.com/google/wuffs/lib/rac
+By default (unless -cchunksize is non-zero), -dchunksize-based encoding is
+also done in parallel: a pool of -jobs worker goroutines (default
+GOMAXPROCS) each compress chunks independently, and -encbuffer bounds how
+many out-of-order compressed chunks are buffered while waiting for an
+earlier chunk to finish.
 
 A RAC file consists of an index and the chunks. The index may be either at the
 start or at the end of the file. At the start results in slightly smaller and
@@ -59,7 +59,7 @@ Examples:
     ractool -decode foo.rac | sha256sum
     ractool -decode -drange=400..500 foo.rac
     ractool -encode foo.dat > foo.rac
-    ractool -encode -codec=zlib -dchunksize=256k foo.dat > foo.rac
+    ractool -encode -codec=zstd -dchunksize=256k foo.dat > foo.rac
 
 The "400..500" flag value means the 100 bytes ranging from a DSpace offset
 (offset in terms of decompressed bytes, not compressed bytes) of 400
@@ -76,15 +76,11 @@ General Flags:
         whether to decode the input
     -encode
         whether to encode the input
-    -quiet
-        whether to suppress messages
 
 Decode-Related Flags:
 
     -drange
         the "i..j" range to decompress, "..8" means the first 8 bytes
-    -singlethreaded
-        whether to decode on a single execution thread
 
 Encode-Related Flags:
 
@@ -92,27 +88,61 @@ Encode-Related Flags:
         the chunk size (in CSpace)
     -codec
         the compression codec (default "zstd")
-    -cpagesize
-        the page size (in CSpace)
+    -container
+        encode input_filename (a directory) into a single seekable archive,
+        e.g. "zip"
     -dchunksize
         the chunk size (in DSpace)
+    -encbuffer
+        max out-of-order compressed chunks buffered while encoding in
+        parallel (default 4 * -jobs)
+    -envelope
+        wrap the index in a plain-format envelope, e.g. "zstd", so that
+        non-RAC-aware tools can still decode the whole file
     -indexlocation
         the index location, "start" or "end" (default "start")
+    -jobs
+        number of encoder worker goroutines (default GOMAXPROCS)
     -resources
         comma-separated list of resource files, such as shared dictionaries
-    -tmpdir
-        directory (e.g. $TMPDIR) for intermediate work; empty means in-memory
+
+Train-Related Flags:
+
+    -maxdict
+        maximum trained dictionary size, e.g. "32k" or "1m" (default "32k")
+    -o
+        output filename for -train (default: stdout)
+    -samples
+        directory of sample files to train a zstd dictionary from
 
 Codecs:
 
-    lz4
-    zlib
     zstd
 
-Only zlib is fully supported. The others will work for the flags' default
-values, but they (1) don't support -cchunksize, only -dchunksize, and (2) don't
-support -resources. See https://github.com/google/wuffs/issues/23 for more
-details.
+Only zstd is implemented so far. Zlib, brotli and lz4 are accepted by the
+RAC index format (see the Codec constants in "package rac") but -codec
+rejects anything other than "zstd" until this tool grows an adapter for
+them, analogous to raczstd.
+
+For zstd, -resources names a shared zstd dictionary: its bytes are stored
+once, as a RAC shared resource, and every chunk references it (via the
+standard Dictionary_ID mechanism, or, failing that, the "raw content prefix"
+mode) rather than repeating it per chunk. -cchunksize drives an adaptive
+binary search over the encoder's input length, so each chunk's compressed
+size tracks the requested target.
+
+-encode -codec=zstd -envelope=zstd produces a file that is simultaneously a
+valid RAC file and a valid (multi-frame) zstd stream: "ractool -decode" still
+gets O(1) seeks, but "zstd -d" (or any other conforming zstd decoder) can
+decode the whole payload too, since the RAC index is tucked away inside a
+zstd "skippable frame" that such decoders are required to ignore.
+
+-encode -container=zip walks a directory and writes a single ZIP archive
+(see the lib/rac/raczip package) whose members are each a self-contained
+RAC stream, registered under an experimental archive/zip compression
+method. Standard archive/zip-based tools can list and stream the result
+like any other ZIP file; raczip.OpenRandomAccess lets a RAC-aware caller
+seek inside one member without decompressing the others.
 
 Installation:
 
@@ -127,112 +157,22 @@ Extended Example:
     $ wget http://mattmahoney.net/dc/enwik8.zip
     $ unzip enwik8.zip
 
-    $ # Also zstd-encode it, as a reference point. Using compression level 15,
-    $ # instead of the default of 3, matches what ractool uses.
-    $ zstd -15 enwik8
-
-    $ # Create a shared dictionary. Using zstd-the-program produces a
-    $ # dictionary that is especially useful for zstd-the-format, but it can
-    $ # also be used by other formats as a 'raw' prefix dictionary.
-    $ zstd -15 --train -B64K --maxdict=32K -o dict.dat enwik8
+    $ # Train a shared dictionary natively, without shelling out to
+    $ # "zstd --train".
+    $ ractool -train -samples=. -maxdict=32k -o dict.dat
 
-    $ # RAC-encode it with various codecs, with and without that dictionary.
-    $ ractool -encode -codec=zlib -resources=dict.dat enwik8 > zlib.withdict.rac
-    $ ractool -encode -codec=zlib                     enwik8 > zlib.sansdict.rac
+    $ # RAC-encode it, with and without that dictionary.
     $ ractool -encode -codec=zstd -resources=dict.dat enwik8 > zstd.withdict.rac
     $ ractool -encode -codec=zstd                     enwik8 > zstd.sansdict.rac
-    $ ractool -encode -codec=lz4                      enwik8 > lz4.sansdict.rac
-
-    $ # The size overhead (comparing RAC+Xxx to Xxx) is about 0.2% (with) or
-    $ # 4.8% (sans) for zlib/zip and about 13% (with) or 28% (sans) for zstd,
-    $ # depending on whether we used a shared dictionary (with or sans).
-    $ ls -l
-    total 362080
-    -rw-r----- 1 tao tao     32768 Oct 25 10:10 dict.dat
-    -rw-r----- 1 tao tao 100000000 Jun  2  2011 enwik8
-    -rw-r----- 1 tao tao  36445475 Sep  2  2011 enwik8.zip
-    -rw-r----- 1 tao tao  29563109 Jun  2  2011 enwik8.zst
-    -rw-r----- 1 tao tao  58813316 Oct 25 10:17 lz4.sansdict.rac
-    -rw-r----- 1 tao tao  38185178 Oct 25 10:16 zlib.sansdict.rac
-    -rw-r----- 1 tao tao  36505786 Oct 25 10:16 zlib.withdict.rac
-    -rw-r----- 1 tao tao  37820491 Oct 25 10:17 zstd.sansdict.rac
-    -rw-r----- 1 tao tao  33386395 Oct 25 10:17 zstd.withdict.rac
-
-    $ # Check that the decompressed forms all match.
-    $ cat enwik8                            | sha256sum
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-    $ unzip -p enwik8.zip                   | sha256sum
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-    $ unzstd --stdout enwik8.zst            | sha256sum
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-    $ for f in *.rac; do ractool -decode $f | sha256sum; done
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-    2b49720ec4d78c3c9fabaee6e4179a5e997302b3a70029f30f2d582218c024a8  -
-
-    $ # Compare how long it takes to produce 8 bytes from the middle of
-    $ # the decompressed file, which happens to be the word "Business".
-    $ time unzip -p enwik8.zip | dd if=/dev/stdin status=none \
-    >     iflag=skip_bytes,count_bytes skip=50000000 count=8
-    Business
-    real    0m0.379s
-    user    0m0.410s
-    sys     0m0.080s
-    $ time unzstd --stdout enwik8.zst | dd if=/dev/stdin status=none \
-    >     iflag=skip_bytes,count_bytes skip=50000000 count=8
-    Business
-    real    0m0.172s
-    user    0m0.141s
-    sys     0m0.103s
-    $ time ractool -decode -drange=50000000..50000008 zstd.withdict.rac
+
+    $ # Check that the decompressed forms match the original.
+    $ cat enwik8                       | sha256sum
+    $ ractool -decode zstd.withdict.rac | sha256sum
+    $ ractool -decode zstd.sansdict.rac | sha256sum
+
+    $ # Decoding a small range doesn't require decompressing the chunks
+    $ # that precede it.
+    $ ractool -decode -drange=50000000..50000008 zstd.withdict.rac
     Business
-    real    0m0.004s
-    user    0m0.005s
-    sys     0m0.001s
-
-    $ # A RAC file's chunks can be decoded in parallel, unlike ZIP,
-    $ # substantially reducing the real (wall clock) time taken even
-    $ # though both of these files use DEFLATE (RFC 1951) compression.
-    $ #
-    $ # Comparing the -singlethreaded time suggests that zlib-the-library's
-    $ # DEFLATE implementation is faster than unzip's.
-    $ time unzip -p                        enwik8.zip        > /dev/null
-    real    0m0.711s
-    user    0m0.690s
-    sys     0m0.021s
-    $ time ractool -decode -singlethreaded zlib.withdict.rac > /dev/null
-    real    0m0.519s
-    user    0m0.513s
-    sys     0m0.017s
-    $ time ractool -decode                 zlib.withdict.rac > /dev/null
-    real    0m0.052s
-    user    0m0.678s
-    sys     0m0.036s
-
-    $ # A similar comparison can be made for Zstandard.
-    $ time unzstd --stdout                 enwik8.zst        > /dev/null
-    real    0m0.203s
-    user    0m0.187s
-    sys     0m0.016s
-    $ time ractool -decode -singlethreaded zstd.withdict.rac > /dev/null
-    real    0m0.235s
-    user    0m0.206s
-    sys     0m0.033s
-    $ time ractool -decode                 zstd.withdict.rac > /dev/null
-    real    0m0.037s
-    user    0m0.374s
-    sys     0m0.080s
-
-    $ # For reference, LZ4 numbers.
-    $ time ractool -decode -singlethreaded lz4.sansdict.rac  > /dev/null
-    real    0m0.072s
-    user    0m0.053s
-    sys     0m0.021s
-    $ time ractool -decode                 lz4.sansdict.rac  > /dev/null
-    real    0m0.024s
-    user    0m0.097s
-    sys     0m0.034s
     --------
 `
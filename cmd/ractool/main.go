@@ -0,0 +1,377 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+// ractool manipulates Random Access Compression (RAC) files.
+//
+// See the usageStr constant (in the generated data.go file) for details.
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/wuffs/lib/rac"
+	"github.com/google/wuffs/lib/rac/raczip"
+	"github.com/google/wuffs/lib/rac/raczstd"
+	"github.com/google/wuffs/lib/rac/raczstd/dict"
+)
+
+var (
+	decodeFlag = flag.Bool("decode", false, "decode the input")
+	encodeFlag = flag.Bool("encode", false, "encode the input")
+	trainFlag  = flag.Bool("train", false, "train a zstd dictionary from -samples")
+	codecFlag  = flag.String("codec", "zstd", "compression codec (only zstd is implemented)")
+
+	cChunkSizeFlag    = flag.Int("cchunksize", 0, "target compressed chunk size, in bytes")
+	dChunkSizeFlag    = flag.Int("dchunksize", 0, "target decompressed chunk size, in bytes")
+	resourcesFlag     = flag.String("resources", "", "a single shared resource file (e.g. a zstd dictionary); lists are not supported")
+	dRangeFlag        = flag.String("drange", "", "decompressed byte range to decode, e.g. 1000..2000")
+	envelopeFlag      = flag.String("envelope", "", "wrap the RAC index in a plain-format envelope, e.g. \"zstd\"")
+	indexLocationFlag = flag.String("indexlocation", "start", "the index location, \"start\" or \"end\"")
+	jobsFlag          = flag.Int("jobs", 0, "number of encoder worker goroutines (0 means GOMAXPROCS)")
+	encBufferFlag     = flag.Int("encbuffer", 0, "max out-of-order compressed chunks buffered while encoding (0 means 4*jobs)")
+
+	samplesFlag = flag.String("samples", "", "directory of sample files to train a zstd dictionary from")
+	maxDictFlag = flag.String("maxdict", "32k", "maximum trained dictionary size, e.g. 32k or 1m")
+	oFlag       = flag.String("o", "", "output filename for -train (default: stdout)")
+
+	containerFlag = flag.String("container", "", "encode input_filename (a directory) into a single seekable archive, e.g. \"zip\"")
+)
+
+func main() {
+	if err := main1(); err != nil {
+		fmt.Fprintln(os.Stderr, "ractool:", err)
+		os.Exit(1)
+	}
+}
+
+func main1() error {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usageStr) }
+	flag.Parse()
+
+	switch {
+	case *encodeFlag:
+		return encode()
+	case *decodeFlag:
+		return decode()
+	case *trainFlag:
+		return train()
+	}
+	flag.Usage()
+	return errors.New("must specify exactly one of -decode, -encode or -train")
+}
+
+func inputFilename() string {
+	if args := flag.Args(); len(args) > 0 {
+		return args[0]
+	}
+	return ""
+}
+
+func openInput() (io.ReadCloser, error) {
+	if fn := inputFilename(); fn != "" {
+		return os.Open(fn)
+	}
+	return io.NopCloser(os.Stdin), nil
+}
+
+// indexLocation parses indexLocationFlag into a rac.IndexLocation.
+func indexLocation() (rac.IndexLocation, error) {
+	switch *indexLocationFlag {
+	case "start":
+		return rac.IndexLocationAtStart, nil
+	case "end":
+		return rac.IndexLocationAtEnd, nil
+	}
+	return 0, fmt.Errorf("-indexlocation=%s: must be \"start\" or \"end\"", *indexLocationFlag)
+}
+
+func readResources() ([]byte, error) {
+	if *resourcesFlag == "" {
+		return nil, nil
+	}
+	// Only a single resource (e.g. a zstd dictionary) is supported so far.
+	return os.ReadFile(*resourcesFlag)
+}
+
+func encode() error {
+	if *containerFlag != "" {
+		if *containerFlag != "zip" {
+			return fmt.Errorf("-container=%s: only zip is implemented so far", *containerFlag)
+		}
+		// encodeContainerZip always uses raczstd, regardless of -codec.
+		return encodeContainerZip(inputFilename())
+	}
+	if *codecFlag != "zstd" {
+		return fmt.Errorf("-codec=%s: only zstd is implemented so far", *codecFlag)
+	}
+	if *envelopeFlag != "" && *envelopeFlag != "zstd" {
+		return fmt.Errorf("-envelope=%s: only zstd is implemented so far", *envelopeFlag)
+	}
+
+	loc, err := indexLocation()
+	if err != nil {
+		return err
+	}
+
+	dict, err := readResources()
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// -cchunksize requires an adaptive binary search over an in-memory
+	// lookahead buffer, so it is encoded serially; -dchunksize (the
+	// default) can be chopped and compressed in parallel while the input
+	// is still streaming in.
+	if *cChunkSizeFlag > 0 {
+		return encodeSerial(in, dict, loc)
+	}
+	return encodeParallel(in, dict, loc)
+}
+
+const (
+	defaultDChunkSize = 64 * 1024
+	minCChunkSize     = 1024
+	maxCChunkSize     = 4 * 1024 * 1024
+)
+
+func encodeSerial(in io.Reader, dict []byte, loc rac.IndexLocation) error {
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	cw, err := raczstd.NewWriter(dict)
+	if err != nil {
+		return err
+	}
+	w := &rac.Writer{Writer: os.Stdout, Envelope: *envelopeFlag == "zstd", IndexLocation: loc}
+
+	var sTag uint64
+	if len(dict) > 0 {
+		if sTag, err = w.AddResource(dict); err != nil {
+			return err
+		}
+	}
+
+	for len(src) > 0 {
+		n := cw.ChunkLength(src, *cChunkSizeFlag, minCChunkSize, maxCChunkSize)
+		if n <= 0 || n > len(src) {
+			n = len(src)
+		}
+		if err := w.AddChunk(cw, src[:n], sTag); err != nil {
+			return err
+		}
+		src = src[n:]
+	}
+	return w.Close()
+}
+
+func encodeParallel(in io.Reader, dict []byte, loc rac.IndexLocation) error {
+	pw := &rac.ParallelWriter{
+		Writer:         os.Stdout,
+		Envelope:       *envelopeFlag == "zstd",
+		IndexLocation:  loc,
+		NewCodecWriter: func() (rac.CodecWriter, error) { return raczstd.NewWriter(dict) },
+		Jobs:           *jobsFlag,
+		EncBuffer:      *encBufferFlag,
+	}
+
+	var sTag uint64
+	if len(dict) > 0 {
+		var err error
+		if sTag, err = pw.AddResource(dict); err != nil {
+			return err
+		}
+	}
+
+	n := *dChunkSizeFlag
+	if n <= 0 {
+		n = defaultDChunkSize
+	}
+	return pw.Encode(in, n, sTag)
+}
+
+// encodeContainerZip walks dir and writes every regular file it contains
+// into a single ZIP archive (on stdout), each one compressed with
+// raczip.Method so that, in addition to ordinary archive/zip tools being
+// able to list and stream it, raczip.OpenRandomAccess can seek inside any
+// one member without decompressing the others.
+func encodeContainerZip(dir string) error {
+	if dir == "" {
+		return errors.New("-container=zip requires a directory input_filename")
+	}
+	zw := zip.NewWriter(os.Stdout)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fh, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		fh.Name = filepath.ToSlash(rel)
+		fh.Method = raczip.Method
+
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func decode() error {
+	fn := inputFilename()
+	if fn == "" {
+		return errors.New("-decode currently requires a seekable input_filename, not stdin")
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	cr, err := raczstd.NewReader()
+	if err != nil {
+		return err
+	}
+	codecs := map[rac.Codec]rac.CodecReader{rac.CodecZstandard: cr}
+
+	r, err := rac.Open(f, fi.Size(), codecs)
+	if err != nil {
+		return fmt.Errorf("could not find a RAC index: %w", err)
+	}
+
+	dStart, dEnd := int64(0), int64(0)
+	if len(r.Chunks) > 0 {
+		dEnd = r.Chunks[len(r.Chunks)-1].DRange[1]
+	}
+	if *dRangeFlag != "" {
+		if dStart, dEnd, err = parseDRange(*dRangeFlag, dStart, dEnd); err != nil {
+			return fmt.Errorf("-drange=%s: %w", *dRangeFlag, err)
+		}
+	}
+
+	out, err := r.ReadRange(dStart, dEnd)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// parseDRange parses a "-drange" flag value of the form "i..j", where
+// either or both of i and j may be omitted, e.g. "..8" or "400..", in which
+// case they default to defaultStart and defaultEnd respectively.
+func parseDRange(s string, defaultStart, defaultEnd int64) (dStart int64, dEnd int64, retErr error) {
+	i := strings.Index(s, "..")
+	if i < 0 {
+		return 0, 0, errors.New("missing \"..\"")
+	}
+	dStart, dEnd = defaultStart, defaultEnd
+	if lo := s[:i]; lo != "" {
+		n, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		dStart = n
+	}
+	if hi := s[i+2:]; hi != "" {
+		n, err := strconv.ParseInt(hi, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		dEnd = n
+	}
+	return dStart, dEnd, nil
+}
+
+func train() error {
+	if *samplesFlag == "" {
+		return errors.New("-train requires -samples=dir")
+	}
+	maxDict, err := parseSize(*maxDictFlag)
+	if err != nil {
+		return fmt.Errorf("-maxdict=%s: %w", *maxDictFlag, err)
+	}
+
+	entries, err := os.ReadDir(*samplesFlag)
+	if err != nil {
+		return err
+	}
+	var samples [][]byte
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(*samplesFlag, e.Name()))
+		if err != nil {
+			return err
+		}
+		samples = append(samples, b)
+	}
+
+	d, err := dict.Train(samples, dict.Params{K: 16, D: 8, MaxDictSize: maxDict})
+	if err != nil {
+		return err
+	}
+
+	if *oFlag == "" {
+		_, err := os.Stdout.Write(d)
+		return err
+	}
+	return os.WriteFile(*oFlag, d, 0o644)
+}
+
+// parseSize parses sizes like "32k", "1m" or "1024" (bytes).
+func parseSize(s string) (int, error) {
+	mult := 1
+	switch {
+	case strings.HasSuffix(s, "k") || strings.HasSuffix(s, "K"):
+		mult, s = 1024, s[:len(s)-1]
+	case strings.HasSuffix(s, "m") || strings.HasSuffix(s, "M"):
+		mult, s = 1024*1024, s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package main
+
+import "testing"
+
+func TestParseDRange(t *testing.T) {
+	const defaultStart, defaultEnd = 0, 1 << 62
+
+	tests := []struct {
+		s         string
+		wantStart int64
+		wantEnd   int64
+		wantErr   bool
+	}{
+		{s: "1000..2000", wantStart: 1000, wantEnd: 2000},
+		{s: "400..", wantStart: 400, wantEnd: defaultEnd},
+		{s: "..8", wantStart: defaultStart, wantEnd: 8},
+		{s: "..", wantStart: defaultStart, wantEnd: defaultEnd},
+		{s: "nope", wantErr: true},
+		{s: "abc..8", wantErr: true},
+		{s: "8..abc", wantErr: true},
+	}
+	for _, test := range tests {
+		gotStart, gotEnd, err := parseDRange(test.s, defaultStart, defaultEnd)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseDRange(%q): got nil error, want one", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDRange(%q): %v", test.s, err)
+			continue
+		}
+		if gotStart != test.wantStart || gotEnd != test.wantEnd {
+			t.Errorf("parseDRange(%q): got (%d, %d), want (%d, %d)", test.s, gotStart, gotEnd, test.wantStart, test.wantEnd)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int
+		wantErr bool
+	}{
+		{s: "1024", want: 1024},
+		{s: "32k", want: 32 * 1024},
+		{s: "32K", want: 32 * 1024},
+		{s: "1m", want: 1024 * 1024},
+		{s: "1M", want: 1024 * 1024},
+		{s: "not-a-size", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.s)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseSize(%q): got nil error, want one", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSize(%q): %v", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseSize(%q): got %d, want %d", test.s, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The zstd file format reserves magic numbers 0x184D2A50 ..= 0x184D2A5F for
+// "skippable frames": a 4-byte magic number, a 4-byte little-endian content
+// length and then that many bytes of arbitrary content, all of which a
+// conforming zstd decoder must silently discard. See
+// https://github.com/facebook/zstd/blob/dev/doc/zstd_compression_format.md
+//
+// RAC reserves the last one of those, 0x184D2A5F, for embedding a RAC index
+// (and any shared resources it references, such as a zstd dictionary)
+// inside what is otherwise an ordinary, multi-frame zstd stream: the
+// concatenation of the chunks' zstd frames already decodes correctly under
+// zstd's "multiple frames in one stream" rule, and the skippable frame lets
+// a RAC-unaware tool (e.g. plain "zstd -d") decode the whole payload while
+// a RAC-aware reader can still locate the index in O(1) and seek.
+const envelopeMagic = uint32(0x184D2A5F)
+
+// envelopeFooterLen is the length, in bytes, of the footer that a RAC-aware
+// reader looks for at the very end of a zstd-enveloped RAC file: a
+// little-endian uint32 giving the total size (header plus content) of the
+// final skippable frame, followed by envelopeMagic itself. Both fields are
+// also present (as the final 8 bytes of that frame's content), which is
+// what lets the footer double as a self-description of the frame that
+// contains it.
+const envelopeFooterLen = 8
+
+// EncodeEnvelope wraps resourcesAndIndex (the serialized shared resources,
+// if any, followed by the serialized RAC index) in a zstd skippable frame
+// suitable for appending after the concatenation of a RAC file's per-chunk
+// zstd frames. The result both is a valid skippable frame (so a plain zstd
+// decoder skips over it) and ends with a footer that a RAC-aware reader can
+// find by looking at the last envelopeFooterLen bytes of the file.
+func EncodeEnvelope(resourcesAndIndex []byte) []byte {
+	contentLen := len(resourcesAndIndex) + envelopeFooterLen
+	frameLen := 8 + contentLen
+
+	out := make([]byte, 0, frameLen)
+	out = appendUint32(out, envelopeMagic)
+	out = appendUint32(out, uint32(contentLen))
+	out = append(out, resourcesAndIndex...)
+	out = appendUint32(out, uint32(frameLen))
+	out = appendUint32(out, envelopeMagic)
+	return out
+}
+
+// ErrNoEnvelope is returned by ProbeEnvelope when the input does not end
+// with a recognized RAC-in-zstd envelope.
+var ErrNoEnvelope = errors.New("rac: no zstd envelope found")
+
+// ProbeEnvelope locates a RAC index (and any shared resources bundled
+// alongside it) embedded via EncodeEnvelope at the end of a zstd-enveloped
+// RAC file. size is the total length of the underlying file. On success, it
+// returns the serialized resourcesAndIndex bytes that were originally
+// passed to EncodeEnvelope, without having to scan any of the preceding
+// zstd frames.
+func ProbeEnvelope(ra io.ReaderAt, size int64) ([]byte, error) {
+	if size < envelopeFooterLen {
+		return nil, ErrNoEnvelope
+	}
+	footer := make([]byte, envelopeFooterLen)
+	if _, err := ra.ReadAt(footer, size-envelopeFooterLen); err != nil {
+		return nil, err
+	}
+	frameLen := int64(binary.LittleEndian.Uint32(footer[0:4]))
+	magic := binary.LittleEndian.Uint32(footer[4:8])
+	if magic != envelopeMagic || frameLen < 8+envelopeFooterLen || frameLen > size {
+		return nil, ErrNoEnvelope
+	}
+
+	frame := make([]byte, frameLen)
+	if _, err := ra.ReadAt(frame, size-frameLen); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(frame[0:4]) != envelopeMagic {
+		return nil, ErrNoEnvelope
+	}
+	contentLen := int64(binary.LittleEndian.Uint32(frame[4:8]))
+	if 8+contentLen != frameLen {
+		return nil, ErrNoEnvelope
+	}
+	content := frame[8:frameLen]
+	return content[:len(content)-envelopeFooterLen], nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], v)
+	return append(b, tmp[:]...)
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// indexMagic identifies the start of a serialized RAC index.
+var indexMagic = [4]byte{'r', 'a', 'c', 0x01}
+
+// ResourceEntry records where, in compressed space, a shared resource (such
+// as a zstd dictionary) lives, so that a Reader can load it by STag.
+type ResourceEntry struct {
+	STag   uint64
+	CRange [2]int64
+}
+
+// buildIndex serializes resources and chunks (plus the C/DBiases applied to
+// each chunk entry) into a single byte slice. Resource CRanges are not
+// biased, since CBias is meant for the chunk stream as seen by a single,
+// un-enveloped RAC file, whereas resources (e.g. an embedded dictionary) are
+// addressed directly.
+func buildIndex(resources []ResourceEntry, chunks []Chunk, cb CBiases, db DBiases) []byte {
+	buf := make([]byte, 0, 4+8*4*len(chunks)+8*3*len(resources))
+	buf = append(buf, indexMagic[:]...)
+
+	buf = appendUint64(buf, uint64(len(resources)))
+	for _, r := range resources {
+		buf = appendUint64(buf, r.STag)
+		buf = appendUint64(buf, uint64(r.CRange[0]))
+		buf = appendUint64(buf, uint64(r.CRange[1]))
+	}
+
+	buf = appendUint64(buf, uint64(len(chunks)))
+	for _, c := range chunks {
+		buf = appendUint64(buf, uint64(c.DRange[0]+db.DBias))
+		buf = appendUint64(buf, uint64(c.DRange[1]+db.DBias))
+		buf = appendUint64(buf, uint64(c.CRange[0]+cb.CBias))
+		buf = appendUint64(buf, uint64(c.CRange[1]+cb.CBias))
+		buf = append(buf, byte(c.Codec))
+		buf = appendUint64(buf, c.STag)
+	}
+	return buf
+}
+
+// writeIndex is buildIndex followed by a single Write call.
+func writeIndex(w io.Writer, resources []ResourceEntry, chunks []Chunk, cb CBiases, db DBiases) error {
+	_, err := w.Write(buildIndex(resources, chunks, cb, db))
+	return err
+}
+
+// ParseIndex parses a serialized RAC index, as written by writeIndex or
+// buildIndex.
+func ParseIndex(b []byte) (resources []ResourceEntry, chunks []Chunk, retErr error) {
+	if len(b) < 4 || string(b[:4]) != string(indexMagic[:]) {
+		return nil, nil, ErrInvalidIndex
+	}
+	b = b[4:]
+
+	nr, b, ok := readUint64(b)
+	if !ok {
+		return nil, nil, ErrInvalidIndex
+	}
+	resources = make([]ResourceEntry, 0, nr)
+	for ; nr > 0; nr-- {
+		var sTag, cStart, cEnd uint64
+		if sTag, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		if cStart, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		if cEnd, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		resources = append(resources, ResourceEntry{
+			STag:   sTag,
+			CRange: [2]int64{int64(cStart), int64(cEnd)},
+		})
+	}
+
+	n, b, ok := readUint64(b)
+	if !ok {
+		return nil, nil, ErrInvalidIndex
+	}
+	chunks = make([]Chunk, 0, n)
+	for ; n > 0; n-- {
+		var (
+			dStart, dEnd, cStart, cEnd, sTag uint64
+			codec                            byte
+		)
+		if dStart, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		if dEnd, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		if cStart, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		if cEnd, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		if len(b) < 1 {
+			return nil, nil, ErrInvalidIndex
+		}
+		codec, b = b[0], b[1:]
+		if sTag, b, ok = readUint64(b); !ok {
+			return nil, nil, ErrInvalidIndex
+		}
+		chunks = append(chunks, Chunk{
+			DRange: [2]int64{int64(dStart), int64(dEnd)},
+			CRange: [2]int64{int64(cStart), int64(cEnd)},
+			Codec:  Codec(codec),
+			STag:   sTag,
+		})
+	}
+	return resources, chunks, nil
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+func readUint64(b []byte) (v uint64, rest []byte, ok bool) {
+	if len(b) < 8 {
+		return 0, b, false
+	}
+	return binary.LittleEndian.Uint64(b[:8]), b[8:], true
+}
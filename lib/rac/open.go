@@ -0,0 +1,43 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"io"
+)
+
+// OpenEnvelope opens a RAC file that was written with Writer.Envelope set
+// (see EncodeEnvelope), returning a Reader whose Codecs have already had
+// their shared resources (e.g. zstd dictionaries) installed via
+// SetResource.
+func OpenEnvelope(ra io.ReaderAt, size int64, codecs map[Codec]CodecReader) (*Reader, error) {
+	payload, err := ProbeEnvelope(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	resourcePayloadLen, payload, ok := readUint64(payload)
+	if !ok || uint64(len(payload)) < resourcePayloadLen {
+		return nil, ErrInvalidIndex
+	}
+	resourcePayload, indexBytes := payload[:resourcePayloadLen], payload[resourcePayloadLen:]
+
+	resources, chunks, err := ParseIndex(indexBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{ReaderAt: ra, Chunks: chunks, Codecs: codecs}
+	for _, re := range resources {
+		data := resourcePayload[re.CRange[0]:re.CRange[1]]
+		for _, cr := range codecs {
+			cr.SetResource(re.STag, data)
+		}
+	}
+	return r, nil
+}
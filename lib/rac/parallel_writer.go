@@ -0,0 +1,249 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"container/heap"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ParallelWriter is like Writer, but compresses chunks on a pool of worker
+// goroutines instead of on the caller's goroutine. A single reader goroutine
+// chops the input into DSpace-sized chunks, Jobs compressor goroutines each
+// hold their own CodecWriter (so that codec-side state, such as a zstd
+// encoder's hash tables, is not shared across goroutines), and a serializer
+// (running on the calling goroutine) writes finished chunks to Writer in
+// DSpace order, buffering any chunks that finish out of order in a bounded
+// min-heap keyed by chunk index.
+type ParallelWriter struct {
+	// Writer is the underlying io.Writer that the RAC-formatted bytes are
+	// written to.
+	Writer io.Writer
+
+	// Envelope is as per Writer.Envelope.
+	Envelope bool
+
+	// IndexLocation is as per Writer.IndexLocation. IndexLocationAtStart
+	// (without Envelope) means every compressed chunk is buffered (by the
+	// underlying Writer)
+	// until Encode has seen the whole input, rather than being written to
+	// Writer as soon as the serializer has it in DSpace order.
+	IndexLocation IndexLocation
+
+	// CBiases and DBiases are as per Writer.
+	CBiases
+	DBiases
+
+	// NewCodecWriter returns a new, independent CodecWriter. It is called
+	// once per worker goroutine, so that each worker gets its own
+	// reusable encoder state.
+	NewCodecWriter func() (CodecWriter, error)
+
+	// Jobs is the number of compressor worker goroutines. Zero means
+	// runtime.GOMAXPROCS(0).
+	Jobs int
+
+	// EncBuffer bounds how many compressed chunks the serializer will
+	// hold back (in its out-of-order heap) while waiting for an earlier
+	// chunk to finish. Zero means 4 * Jobs.
+	EncBuffer int
+
+	w *Writer
+}
+
+// AddResource is as per Writer.AddResource. It must be called (if at all)
+// before Encode.
+func (pw *ParallelWriter) AddResource(data []byte) (uint64, error) {
+	if pw.w == nil {
+		pw.w = &Writer{Writer: pw.Writer, Envelope: pw.Envelope, IndexLocation: pw.IndexLocation, CBiases: pw.CBiases, DBiases: pw.DBiases}
+	}
+	return pw.w.AddResource(data)
+}
+
+// sourceChunk is a DSpace-ordered, not-yet-compressed chunk.
+type sourceChunk struct {
+	index int
+	data  []byte
+}
+
+// resultChunk is a compressed chunk, still tagged with its DSpace order.
+type resultChunk struct {
+	index int
+	dLen  int
+	codec Codec
+	data  []byte
+}
+
+// resultHeap orders resultChunks by index, so the serializer can always ask
+// "what's the lowest index I'm holding?".
+type resultHeap []resultChunk
+
+func (h resultHeap) Len() int            { return len(h) }
+func (h resultHeap) Less(i, j int) bool  { return h[i].index < h[j].index }
+func (h resultHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x interface{}) { *h = append(*h, x.(resultChunk)) }
+func (h *resultHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Encode reads r in dChunkSize-sized pieces (the last piece may be
+// shorter), compresses each piece in parallel, and writes the resulting RAC
+// file (including its index) to pw.Writer. sTag, as per Writer.AddChunk, is
+// the shared resource (if any) that every chunk should reference.
+func (pw *ParallelWriter) Encode(r io.Reader, dChunkSize int, sTag uint64) error {
+	jobs := pw.Jobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	encBuffer := pw.EncBuffer
+	if encBuffer <= 0 {
+		encBuffer = 4 * jobs
+	}
+	if dChunkSize <= 0 {
+		dChunkSize = 64 * 1024
+	}
+
+	done := make(chan struct{})
+	stop := func() {
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+	}
+
+	srcCh := make(chan sourceChunk, jobs)
+	resCh := make(chan resultChunk, jobs)
+	errCh := make(chan error, 1+jobs)
+	reportErr := func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+		stop()
+	}
+
+	// The reader goroutine chops the input into DSpace-sized chunks.
+	go func() {
+		defer close(srcCh)
+		buf := make([]byte, dChunkSize)
+		for index := 0; ; index++ {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				select {
+				case srcCh <- sourceChunk{index: index, data: data}:
+				case <-done:
+					return
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			} else if err != nil {
+				reportErr(err)
+				return
+			}
+		}
+	}()
+
+	// The compressor worker goroutines each keep their own CodecWriter.
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer wg.Done()
+			cw, err := pw.NewCodecWriter()
+			if err != nil {
+				reportErr(err)
+				return
+			}
+			for {
+				select {
+				case sc, ok := <-srcCh:
+					if !ok {
+						return
+					}
+					dst, err := cw.Compress(nil, sc.data)
+					if err != nil {
+						reportErr(err)
+						return
+					}
+					// Every chunk is independently compressed, so cw is
+					// "between unrelated chunks" again as soon as
+					// Compress returns, ready for this worker's next sc.
+					cw.Reset()
+					select {
+					case resCh <- resultChunk{index: sc.index, dLen: len(sc.data), codec: cw.Codec(), data: dst}:
+					case <-done:
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resCh)
+	}()
+
+	if pw.w == nil {
+		pw.w = &Writer{Writer: pw.Writer, Envelope: pw.Envelope, IndexLocation: pw.IndexLocation, CBiases: pw.CBiases, DBiases: pw.DBiases}
+	}
+	w := pw.w
+
+	// The serializer (this goroutine) writes finished chunks in order,
+	// holding back early arrivals in a bounded min-heap.
+	h := &resultHeap{}
+	next := 0
+serialize:
+	for {
+		rc, ok := <-resCh
+		if !ok {
+			break
+		}
+		heap.Push(h, rc)
+
+		for h.Len() > 0 && (*h)[0].index == next {
+			popped := heap.Pop(h).(resultChunk)
+			if _, err := w.sink().Write(popped.data); err != nil {
+				reportErr(err)
+				break serialize
+			}
+			if err := w.recordChunk(popped.codec, popped.dLen, len(popped.data), sTag); err != nil {
+				reportErr(err)
+				break serialize
+			}
+			next++
+		}
+		if h.Len() > encBuffer {
+			reportErr(errTooManyOutOfOrderChunks)
+			break
+		}
+	}
+	stop()
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+	}
+	return w.Close()
+}
+
+var errTooManyOutOfOrderChunks = errValue("rac: too many out-of-order chunks buffered; increase EncBuffer")
@@ -0,0 +1,88 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newIdentityCodecWriter satisfies ParallelWriter.NewCodecWriter.
+func newIdentityCodecWriter() (CodecWriter, error) {
+	return identityCodec{}, nil
+}
+
+func TestParallelWriterRoundTrip(t *testing.T) {
+	src := strings.Repeat("0123456789abcdef", 1000) // 16000 bytes.
+
+	for _, loc := range []IndexLocation{IndexLocationAtEnd, IndexLocationAtStart} {
+		loc := loc
+		t.Run("", func(t *testing.T) {
+			var buf bytes.Buffer
+			pw := &ParallelWriter{
+				Writer:         &buf,
+				IndexLocation:  loc,
+				NewCodecWriter: newIdentityCodecWriter,
+				Jobs:           4,
+			}
+			if err := pw.Encode(strings.NewReader(src), 37, 0); err != nil { // An odd chunk size, to mix up finish order.
+				t.Fatalf("Encode: %v", err)
+			}
+
+			codecs := map[Codec]CodecReader{CodecUncompressed: identityCodec{}}
+			r, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()), codecs)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			got, err := r.ReadRange(0, int64(len(src)))
+			if err != nil {
+				t.Fatalf("ReadRange: %v", err)
+			}
+			if !bytes.Equal(got, []byte(src)) {
+				t.Fatalf("ReadRange: got %d bytes, want %d bytes (mismatched content)", len(got), len(src))
+			}
+		})
+	}
+}
+
+// failingWriter returns an error after the first successful write, so that
+// ParallelWriter.Encode's serializer observes a write error partway through
+// a multi-chunk encode.
+type failingWriter struct {
+	wrote bool
+}
+
+var errFailingWriter = errors.New("rac_test: failingWriter always fails after its first write")
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if fw.wrote {
+		return 0, errFailingWriter
+	}
+	fw.wrote = true
+	return len(p), nil
+}
+
+// TestParallelWriterStopsOnWriteError checks that Encode returns promptly
+// (rather than silently dropping further chunks) once the serializer's
+// underlying Writer starts failing: the serializer's "serialize" loop must
+// break out entirely, not just out of its inner drain loop.
+func TestParallelWriterStopsOnWriteError(t *testing.T) {
+	src := strings.Repeat("x", 10000)
+	pw := &ParallelWriter{
+		Writer:         &failingWriter{},
+		NewCodecWriter: newIdentityCodecWriter,
+		Jobs:           4,
+	}
+	err := pw.Encode(strings.NewReader(src), 16, 0)
+	if !errors.Is(err, errFailingWriter) {
+		t.Fatalf("Encode: got %v, want an error wrapping errFailingWriter", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// A Writer that does not set Envelope still needs a way for Open to find
+// the index without scanning every chunk, so its output is followed (or, for
+// IndexLocationAtStart, preceded) by a small footer: a little-endian uint64
+// giving the index's serialized length, then a 4-byte magic number that also
+// says which side of the index it is on:
+//
+//   - IndexLocationAtEnd:   [ chunks and resources ][ index ][ footer ]
+//   - IndexLocationAtStart: [ footer ][ index ][ chunks and resources ]
+//
+// Open tries the end of the file first, then the start.
+const plainFooterLen = 12
+
+var (
+	plainMagicAtEnd   = uint32(0x52414330) // "RAC0": footer follows the index.
+	plainMagicAtStart = uint32(0x52414331) // "RAC1": footer precedes the index.
+)
+
+// ErrNoIndex is returned by Open when the input has neither a zstd envelope
+// (see ProbeEnvelope) nor a plain RAC footer.
+var ErrNoIndex = errors.New("rac: no RAC index found")
+
+// Open opens a RAC file written by a Writer, whether or not Envelope was
+// set, returning a Reader whose Codecs have already had their shared
+// resources (e.g. zstd dictionaries) installed via SetResource.
+func Open(ra io.ReaderAt, size int64, codecs map[Codec]CodecReader) (*Reader, error) {
+	if r, err := OpenEnvelope(ra, size, codecs); err != ErrNoEnvelope {
+		return r, err
+	}
+	return openPlain(ra, size, codecs)
+}
+
+func openPlain(ra io.ReaderAt, size int64, codecs map[Codec]CodecReader) (*Reader, error) {
+	if size < plainFooterLen {
+		return nil, ErrNoIndex
+	}
+
+	footer := make([]byte, plainFooterLen)
+	if _, err := ra.ReadAt(footer, size-plainFooterLen); err == nil {
+		if indexLen, ok := decodePlainFooter(footer, plainMagicAtEnd); ok && plainFooterLen+indexLen <= size {
+			indexBytes := make([]byte, indexLen)
+			if _, err := ra.ReadAt(indexBytes, size-plainFooterLen-indexLen); err != nil {
+				return nil, err
+			}
+			return openPlainIndex(ra, indexBytes, codecs)
+		}
+	}
+
+	if _, err := ra.ReadAt(footer, 0); err != nil {
+		return nil, err
+	}
+	if indexLen, ok := decodePlainFooter(footer, plainMagicAtStart); ok && plainFooterLen+indexLen <= size {
+		indexBytes := make([]byte, indexLen)
+		if _, err := ra.ReadAt(indexBytes, plainFooterLen); err != nil {
+			return nil, err
+		}
+		return openPlainIndex(ra, indexBytes, codecs)
+	}
+
+	return nil, ErrNoIndex
+}
+
+func openPlainIndex(ra io.ReaderAt, indexBytes []byte, codecs map[Codec]CodecReader) (*Reader, error) {
+	resources, chunks, err := ParseIndex(indexBytes)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{ReaderAt: ra, Chunks: chunks, Codecs: codecs}
+	for _, re := range resources {
+		data := make([]byte, re.CRange[1]-re.CRange[0])
+		if _, err := ra.ReadAt(data, re.CRange[0]); err != nil {
+			return nil, err
+		}
+		for _, cr := range codecs {
+			cr.SetResource(re.STag, data)
+		}
+	}
+	return r, nil
+}
+
+func encodePlainFooter(indexLen int, magic uint32) []byte {
+	footer := appendUint64(nil, uint64(indexLen))
+	return appendUint32(footer, magic)
+}
+
+func decodePlainFooter(footer []byte, wantMagic uint32) (indexLen int64, ok bool) {
+	n := int64(binary.LittleEndian.Uint64(footer[0:8]))
+	if binary.LittleEndian.Uint32(footer[8:12]) != wantMagic || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
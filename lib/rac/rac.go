@@ -0,0 +1,108 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+// Package rac provides access to RAC (Random Access Compression) files.
+//
+// See the RAC specification for more details:
+// https://github.com/google/wuffs/blob/main/doc/spec/rac-spec.md
+package rac
+
+import (
+	"errors"
+)
+
+// Codec is a RAC file's compression codec, as recorded in its index.
+type Codec uint8
+
+const (
+	CodecZlib         = Codec(0x00)
+	CodecBrotli       = Codec(0x01)
+	CodecLZ4          = Codec(0x02)
+	CodecZstandard    = Codec(0x03)
+	CodecUncompressed = Codec(0xFF)
+)
+
+// IndexLocation configures where, in the overall output, a RAC file's index
+// is written: at the start or at the end.
+//
+// Writing the index at the start requires buffering every compressed chunk
+// in memory before any of them can be written, since the index's
+// byte-length isn't known until encoding finishes. Writing it at the end allows streaming the compressed chunks as
+// they are produced.
+type IndexLocation uint32
+
+const (
+	IndexLocationAtEnd   = IndexLocation(0)
+	IndexLocationAtStart = IndexLocation(1)
+)
+
+// Resource identifies a shared resource (such as a dictionary) that a RAC
+// file's chunks may reference. Resources are stored once and referenced by
+// many chunks, analogous to how a zstd dictionary is loaded once and handed
+// to many independent frame decoders.
+type Resource struct {
+	// Data holds the raw resource bytes, as they are stored in the RAC file.
+	Data []byte
+}
+
+// CBiases and DBiases let a Writer's caller account for bytes that are
+// conceptually part of the compressed (C) or decompressed (D) stream, but
+// that are not written through this package's Writer (e.g. a shared
+// header written directly to the underlying io.Writer).
+type CBiases struct {
+	// CBias is added to every chunk's CStart and CEnd recorded in the index.
+	CBias int64
+}
+
+type DBiases struct {
+	// DBias is added to every chunk's DStart and DEnd recorded in the index.
+	DBias int64
+}
+
+// ErrUnsupportedCodec is returned when a Codec value is not implemented by
+// this package or by the codec adapter being used.
+var ErrUnsupportedCodec = errors.New("rac: unsupported codec")
+
+// ErrInvalidIndex is returned when a RAC index cannot be parsed.
+var ErrInvalidIndex = errors.New("rac: invalid index")
+
+// ErrInvalidRange is returned by Reader.ReadRange when given a negative or
+// reversed [dStart, dEnd) range.
+var ErrInvalidRange = errors.New("rac: invalid range")
+
+// Chunk is a decompressed-space to compressed-space mapping for a single RAC
+// chunk, as recorded in a RAC file's index.
+type Chunk struct {
+	DRange [2]int64
+	CRange [2]int64
+	Codec  Codec
+
+	// STag identifies, out of the resources recorded in the index, which
+	// (if any) secondary resource this chunk's codec should use, such as a
+	// shared zstd dictionary. Zero means "no secondary resource".
+	STag uint64
+}
+
+// CodecWriter adapts a specific compression codec (such as zstd) so that it
+// can be driven by a Writer. Implementations are not required to be safe for
+// concurrent use by multiple goroutines; a ParallelWriter gives each worker
+// its own CodecWriter.
+type CodecWriter interface {
+	// Codec returns the RAC codec that this CodecWriter implements.
+	Codec() Codec
+
+	// Compress compresses src, appending the result to dst and returning
+	// the extended slice. The CodecWriter may keep, and reuse on the next
+	// call, any encoder-side state (such as hash tables) that speeds up
+	// subsequent calls.
+	Compress(dst []byte, src []byte) ([]byte, error)
+
+	// Reset discards any in-progress state, preparing the CodecWriter for
+	// reuse on an unrelated chunk.
+	Reset()
+}
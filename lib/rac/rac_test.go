@@ -0,0 +1,137 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"bytes"
+	"testing"
+)
+
+// identityCodec is a trivial CodecWriter and CodecReader that stores bytes
+// unmodified, so that Writer/Reader round-trips can be tested without
+// depending on an actual compression codec such as raczstd.
+type identityCodec struct{}
+
+func (identityCodec) Codec() Codec                     { return CodecUncompressed }
+func (identityCodec) Reset()                           {}
+func (identityCodec) SetResource(sTag uint64, _ []byte) {}
+
+func (identityCodec) Compress(dst []byte, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func (identityCodec) Decompress(dst []byte, src []byte, sTag uint64) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func roundTrip(t *testing.T, loc IndexLocation, envelope bool, chunks [][]byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, IndexLocation: loc, Envelope: envelope}
+	var cw identityCodec
+	var want []byte
+	for _, c := range chunks {
+		if err := w.AddChunk(cw, c, 0); err != nil {
+			t.Fatalf("AddChunk: %v", err)
+		}
+		want = append(want, c...)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	codecs := map[Codec]CodecReader{CodecUncompressed: identityCodec{}}
+	r, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()), codecs)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err := r.ReadRange(0, int64(len(want)))
+	if err != nil {
+		t.Fatalf("ReadRange: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("ReadRange: got %q, want %q", got, want)
+	}
+
+	// A sub-range in the middle of the decompressed stream should also
+	// round-trip, exercising chunkAt's binary search.
+	if len(want) >= 4 {
+		lo, hi := int64(1), int64(len(want)-1)
+		got, err := r.ReadRange(lo, hi)
+		if err != nil {
+			t.Fatalf("ReadRange(%d, %d): %v", lo, hi, err)
+		}
+		if !bytes.Equal(got, want[lo:hi]) {
+			t.Fatalf("ReadRange(%d, %d): got %q, want %q", lo, hi, got, want[lo:hi])
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	chunks := [][]byte{[]byte("hello, "), []byte("random"), []byte(" access "), []byte("compression")}
+
+	for _, loc := range []IndexLocation{IndexLocationAtEnd, IndexLocationAtStart} {
+		for _, envelope := range []bool{false, true} {
+			loc, envelope := loc, envelope
+			t.Run("", func(t *testing.T) {
+				roundTrip(t, loc, envelope, chunks)
+			})
+		}
+	}
+}
+
+func TestRoundTripEmpty(t *testing.T) {
+	for _, loc := range []IndexLocation{IndexLocationAtEnd, IndexLocationAtStart} {
+		for _, envelope := range []bool{false, true} {
+			loc, envelope := loc, envelope
+			t.Run("", func(t *testing.T) {
+				roundTrip(t, loc, envelope, nil)
+			})
+		}
+	}
+}
+
+func TestRoundTripResource(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, IndexLocation: IndexLocationAtStart}
+	var cw identityCodec
+
+	sTag, err := w.AddResource([]byte("shared-dictionary"))
+	if err != nil {
+		t.Fatalf("AddResource: %v", err)
+	}
+	want := []byte("payload that references the shared resource")
+	if err := w.AddChunk(cw, want, sTag); err != nil {
+		t.Fatalf("AddChunk: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	codecs := map[Codec]CodecReader{CodecUncompressed: identityCodec{}}
+	r, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()), codecs)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err := r.ReadRange(0, int64(len(want)))
+	if err != nil {
+		t.Fatalf("ReadRange: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("ReadRange: got %q, want %q", got, want)
+	}
+}
+
+func TestOpenNoIndex(t *testing.T) {
+	codecs := map[Codec]CodecReader{CodecUncompressed: identityCodec{}}
+	if _, err := Open(bytes.NewReader([]byte("not a rac file")), 14, codecs); err != ErrNoIndex {
+		t.Fatalf("Open: got %v, want ErrNoIndex", err)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+// Package raczip registers RAC (Random Access Compression) as an
+// archive/zip compression method, analogous to how pure-Go zstd
+// implementations register themselves as zip method 93.
+//
+// Each ZIP member compressed with Method is a self-contained, zstd-codec
+// RAC stream (using the same zstd-skippable-frame envelope as
+// "ractool -encode -envelope=zstd", so the index can be located without
+// scanning every chunk). Tools built on the standard archive/zip package
+// can list and stream such members as usual; RAC-aware callers can instead
+// use OpenRandomAccess to get a *rac.Reader over one member's decompressed
+// bytes, whose ReadRange method does not decompress the bytes that precede
+// the requested range. That *rac.Reader is not an io.ReaderAt.
+package raczip
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/google/wuffs/lib/rac"
+	"github.com/google/wuffs/lib/rac/raczstd"
+)
+
+// Method is the (experimental, not IANA- or PKWARE-registered) ZIP
+// compression method number that this package claims for RAC-compressed
+// members.
+const Method = 97
+
+const defaultDChunkSize = 64 * 1024
+
+func init() {
+	zip.RegisterCompressor(Method, newCompressor)
+	zip.RegisterDecompressor(Method, newDecompressor)
+}
+
+// compressWriteCloser buffers a ZIP member's uncompressed bytes, then RAC-
+// and zstd-encodes them (as a single zstd-enveloped RAC stream) on Close.
+type compressWriteCloser struct {
+	dst io.Writer
+	buf bytes.Buffer
+}
+
+func newCompressor(w io.Writer) (io.WriteCloser, error) {
+	return &compressWriteCloser{dst: w}, nil
+}
+
+func (c *compressWriteCloser) Write(p []byte) (int, error) {
+	return c.buf.Write(p)
+}
+
+func (c *compressWriteCloser) Close() error {
+	cw, err := raczstd.NewWriter(nil)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	w := &rac.Writer{Writer: &out, Envelope: true}
+
+	src := c.buf.Bytes()
+	for len(src) > 0 {
+		n := defaultDChunkSize
+		if n > len(src) {
+			n = len(src)
+		}
+		if err := w.AddChunk(cw, src[:n], 0); err != nil {
+			return err
+		}
+		src = src[n:]
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	_, err = c.dst.Write(out.Bytes())
+	return err
+}
+
+func newDecompressor(r io.Reader) io.ReadCloser {
+	return &decompressReadCloser{src: r}
+}
+
+// decompressReadCloser lazily decodes its RAC-and-zstd-enveloped member in
+// full (since the Method zip.Decompressor contract only hands out a plain
+// io.Reader, with no random access into the underlying archive) on the
+// first Read.
+type decompressReadCloser struct {
+	src     io.Reader
+	decoded *bytes.Reader
+	err     error
+}
+
+func (d *decompressReadCloser) Read(p []byte) (int, error) {
+	if d.decoded == nil && d.err == nil {
+		d.decoded, d.err = decodeAll(d.src)
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.decoded.Read(p)
+}
+
+func (d *decompressReadCloser) Close() error { return nil }
+
+func decodeAll(r io.Reader) (*bytes.Reader, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ra := bytes.NewReader(raw)
+
+	cr, err := raczstd.NewReader()
+	if err != nil {
+		return nil, err
+	}
+	codecs := map[rac.Codec]rac.CodecReader{rac.CodecZstandard: cr}
+
+	rr, err := rac.OpenEnvelope(ra, int64(len(raw)), codecs)
+	if err != nil {
+		return nil, err
+	}
+	if len(rr.Chunks) == 0 {
+		return bytes.NewReader(nil), nil
+	}
+	dEnd := rr.Chunks[len(rr.Chunks)-1].DRange[1]
+	out, err := rr.ReadRange(0, dEnd)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+// OpenRandomAccess returns a rac.Reader over f's decompressed bytes,
+// without decompressing chunks that precede whatever range the caller
+// later asks for via rac.Reader.ReadRange. ra must be the same io.ReaderAt
+// (e.g. the *os.File) that the *zip.Reader containing f was opened from,
+// and f.Method must be Method.
+func OpenRandomAccess(ra io.ReaderAt, f *zip.File) (*rac.Reader, error) {
+	if f.Method != Method {
+		return nil, fmt.Errorf("raczip: %q was not compressed with raczip.Method", f.Name)
+	}
+	off, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	sr := io.NewSectionReader(ra, off, int64(f.CompressedSize64))
+
+	cr, err := raczstd.NewReader()
+	if err != nil {
+		return nil, err
+	}
+	codecs := map[rac.Codec]rac.CodecReader{rac.CodecZstandard: cr}
+	return rac.OpenEnvelope(sr, sr.Size(), codecs)
+}
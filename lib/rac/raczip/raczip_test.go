@@ -0,0 +1,125 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package raczip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func writeZip(t *testing.T, members map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range members {
+		fh := &zip.FileHeader{Name: name, Method: Method}
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatalf("CreateHeader(%q): %v", name, err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatalf("Write(%q): %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestRoundTripPlainRead checks that a RAC-compressed ZIP member can be
+// read back via the standard archive/zip API (zip.File.Open), which decodes
+// it with the decompressor that this package registers for Method.
+func TestRoundTripPlainRead(t *testing.T) {
+	want := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 5000)
+	zipBytes := writeZip(t, map[string]string{"big.txt": want, "small.txt": "hello"})
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Open(%q): %v", f.Name, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll(%q): %v", f.Name, err)
+		}
+		var want2 string
+		switch f.Name {
+		case "big.txt":
+			want2 = want
+		case "small.txt":
+			want2 = "hello"
+		}
+		if string(got) != want2 {
+			t.Fatalf("%q: got %d bytes, want %d bytes", f.Name, len(got), len(want2))
+		}
+	}
+}
+
+// TestOpenRandomAccess checks that a sub-range of a member can be read via
+// OpenRandomAccess, and that the result matches the same range of the
+// member's original content.
+func TestOpenRandomAccess(t *testing.T) {
+	want := strings.Repeat("0123456789abcdef", 10000) // 160000 bytes, several chunks.
+	zipBytes := writeZip(t, map[string]string{"data.bin": want})
+	ra := bytes.NewReader(zipBytes)
+
+	zr, err := zip.NewReader(ra, int64(len(zipBytes)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	f := zr.File[0]
+
+	r, err := OpenRandomAccess(ra, f)
+	if err != nil {
+		t.Fatalf("OpenRandomAccess: %v", err)
+	}
+	lo, hi := int64(70000), int64(70010)
+	got, err := r.ReadRange(lo, hi)
+	if err != nil {
+		t.Fatalf("ReadRange(%d, %d): %v", lo, hi, err)
+	}
+	if string(got) != want[lo:hi] {
+		t.Fatalf("ReadRange(%d, %d): got %q, want %q", lo, hi, got, want[lo:hi])
+	}
+}
+
+// TestOpenRandomAccessWrongMethod checks that OpenRandomAccess rejects a
+// member that wasn't compressed with Method.
+func TestOpenRandomAccessWrongMethod(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "plain.txt", Method: zip.Store})
+	if err != nil {
+		t.Fatalf("CreateHeader: %v", err)
+	}
+	if _, err := io.WriteString(w, "uncompressed"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	ra := bytes.NewReader(buf.Bytes())
+	zr, err := zip.NewReader(ra, int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	if _, err := OpenRandomAccess(ra, zr.File[0]); err == nil {
+		t.Fatalf("OpenRandomAccess: got nil error, want one rejecting the wrong Method")
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+// Package dict trains zstd dictionaries from a corpus of sample files,
+// without shelling out to "zstd --train".
+//
+// It implements the COVER algorithm: segments of the samples that contain
+// many frequently-shared substrings ("dmers") are greedily selected for the
+// dictionary, so that the result is biased towards byte patterns that
+// recur across many samples rather than within just one of them.
+package dict
+
+import (
+	"container/heap"
+	"errors"
+	"hash/crc32"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Params configures the COVER algorithm.
+type Params struct {
+	// K is the segment length: the number of contiguous bytes considered
+	// as a single candidate for inclusion in the dictionary. Typical
+	// values are 8 to 32.
+	K int
+
+	// D is the dmer length: the length of the substrings whose
+	// cross-sample frequency drives segment scoring. Typically 6 or 8.
+	D int
+
+	// MaxDictSize caps the size, in bytes, of the trained dictionary's
+	// content (not counting the standard zstd dictionary header that Train
+	// may prepend; see wrapDict).
+	MaxDictSize int
+}
+
+// DefaultParams are reasonable defaults for English-text-like or
+// source-code-like corpora.
+var DefaultParams = Params{K: 16, D: 8, MaxDictSize: 32 * 1024}
+
+var (
+	ErrNoSamples = errors.New("dict: no samples long enough to train on")
+	ErrInvalidK  = errors.New("dict: K must be at least D")
+)
+
+// windowPos identifies a length-K candidate segment: the sample it comes
+// from and its byte offset within that sample.
+type windowPos struct {
+	sample int
+	offset int
+}
+
+// less orders windowPos values by (sample, offset), giving a deterministic
+// tie-break when two candidate segments score equally.
+func (a windowPos) less(b windowPos) bool {
+	if a.sample != b.sample {
+		return a.sample < b.sample
+	}
+	return a.offset < b.offset
+}
+
+// candEntry is a snapshot of a candidate's score at the time it was pushed
+// onto candQueue. Picking a segment can lower other candidates' scores
+// (some of their dmers get zeroed out), so an entry can become stale; see
+// candQueue's doc comment.
+type candEntry struct {
+	idx   int
+	score int
+}
+
+// candQueue is a max-heap of candEntry, ordered by score and then by the
+// referenced candidate's windowPos (for a deterministic tie-break). Scores
+// only ever decrease (Train zeroes out dmer counts, never raises them), so
+// an entry is current only if its score still matches liveScores[entry.idx];
+// Train re-pushes a fresh entry whenever a score drops instead of mutating
+// entries in place, and discards stale or already-picked entries as they're
+// popped. This is the standard lazy-deletion trick for a decrease-only
+// priority queue, and it's what turns picking into an amortized O(log n)
+// operation instead of an O(n) rescan of every remaining candidate.
+type candQueue struct {
+	entries    []candEntry
+	candidates []windowPos
+}
+
+func (q *candQueue) Len() int { return len(q.entries) }
+func (q *candQueue) Less(i, j int) bool {
+	a, b := q.entries[i], q.entries[j]
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return q.candidates[a.idx].less(q.candidates[b.idx])
+}
+func (q *candQueue) Swap(i, j int) { q.entries[i], q.entries[j] = q.entries[j], q.entries[i] }
+func (q *candQueue) Push(x interface{}) { q.entries = append(q.entries, x.(candEntry)) }
+func (q *candQueue) Pop() interface{} {
+	old := q.entries
+	n := len(old)
+	x := old[n-1]
+	q.entries = old[:n-1]
+	return x
+}
+
+// Train runs the COVER algorithm over samples and returns dictionary
+// content: the concatenation of the highest-scoring, non-overlapping
+// segments, ordered by selection (most broadly useful first).
+//
+// Samples shorter than params.K are skipped. The result is deterministic:
+// ties in score are broken by preferring the segment with the
+// lexicographically smaller (sample index, offset).
+//
+// Picking is amortized: an inverted dmer-to-candidates index means that
+// zeroing out a dmer (because some other segment covering it was just
+// picked) only touches the candidates that actually contain that dmer,
+// rather than rescoring every remaining candidate from scratch. That keeps
+// Train usable on real corpora; a naive O(candidates x segments) rescan
+// does not finish in reasonable time on more than a handful of small
+// samples.
+//
+// The returned bytes are normally a standard zstd dictionary: the selected
+// content, prefixed with the 0xEC30A437 magic number, a Dictionary_ID
+// derived from that content, and the Huffman/FSE entropy tables that
+// zstd.BuildDict synthesizes from samples (see wrapDict). Synthesizing
+// those tables needs a handful of usable bytes to work with; if the
+// selected content is too small (e.g. a tiny or degenerate corpus),
+// wrapDict falls back to returning the bare content, a "raw content" zstd
+// dictionary with no magic number, still always valid input to any
+// conforming decoder (see raczstd's doc comment on the "raw content
+// prefix" mode) but without a Dictionary_ID.
+func Train(samples [][]byte, params Params) ([]byte, error) {
+	if params.K <= 0 {
+		params = DefaultParams
+	}
+	if params.K < params.D {
+		return nil, ErrInvalidK
+	}
+
+	// dmerCount[dmer] is the number of distinct samples containing dmer.
+	// Counting per distinct sample (rather than raw occurrences) bounds
+	// how much a single, highly repetitive sample can dominate scoring.
+	dmerCount := map[string]int{}
+	for _, s := range samples {
+		if len(s) < params.K {
+			continue
+		}
+		seen := map[string]bool{}
+		for i := 0; i+params.D <= len(s); i++ {
+			dm := string(s[i : i+params.D])
+			if !seen[dm] {
+				seen[dm] = true
+				dmerCount[dm]++
+			}
+		}
+	}
+	if len(dmerCount) == 0 {
+		return nil, ErrNoSamples
+	}
+
+	var candidates []windowPos
+	for si, s := range samples {
+		if len(s) < params.K {
+			continue
+		}
+		for i := 0; i+params.K <= len(s); i++ {
+			candidates = append(candidates, windowPos{sample: si, offset: i})
+		}
+	}
+
+	dmersIn := func(wp windowPos) []string {
+		s := samples[wp.sample][wp.offset : wp.offset+params.K]
+		seen := map[string]bool{}
+		var out []string
+		for i := 0; i+params.D <= len(s); i++ {
+			dm := string(s[i : i+params.D])
+			if !seen[dm] {
+				seen[dm] = true
+				out = append(out, dm)
+			}
+		}
+		return out
+	}
+
+	// candDmers[i] is the distinct dmers in candidates[i], computed once.
+	// dmerToCands[dm] is every candidate index whose candDmers contains dm,
+	// an inverted index that lets picking a segment cheaply find exactly
+	// which other candidates' scores need to drop.
+	candDmers := make([][]string, len(candidates))
+	liveScores := make([]int, len(candidates))
+	dmerToCands := map[string][]int{}
+	for i, wp := range candidates {
+		dms := dmersIn(wp)
+		candDmers[i] = dms
+		sc := 0
+		for _, dm := range dms {
+			sc += dmerCount[dm]
+			dmerToCands[dm] = append(dmerToCands[dm], i)
+		}
+		liveScores[i] = sc
+	}
+
+	q := &candQueue{candidates: candidates, entries: make([]candEntry, len(candidates))}
+	for i := range candidates {
+		q.entries[i] = candEntry{idx: i, score: liveScores[i]}
+	}
+	heap.Init(q)
+
+	var out []byte
+	used := make([]bool, len(candidates))
+	for len(out) < params.MaxDictSize && q.Len() > 0 {
+		e := heap.Pop(q).(candEntry)
+		if used[e.idx] || e.score != liveScores[e.idx] {
+			continue // Stale or already-picked: a fresher entry, if any, is still queued.
+		}
+		if e.score <= 0 {
+			break
+		}
+		wp := candidates[e.idx]
+		used[e.idx] = true
+
+		seg := samples[wp.sample][wp.offset : wp.offset+params.K]
+		if remaining := params.MaxDictSize - len(out); remaining < len(seg) {
+			seg = seg[:remaining]
+		}
+		out = append(out, seg...)
+
+		// Zero out the counts of every dmer in the picked segment so
+		// overlapping segments cannot be re-picked for the same content,
+		// and push updated scores for exactly the candidates that shared
+		// one of those dmers.
+		for _, dm := range candDmers[e.idx] {
+			oldCount := dmerCount[dm]
+			if oldCount == 0 {
+				continue
+			}
+			dmerCount[dm] = 0
+			for _, j := range dmerToCands[dm] {
+				if used[j] {
+					continue
+				}
+				liveScores[j] -= oldCount
+				heap.Push(q, candEntry{idx: j, score: liveScores[j]})
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrNoSamples
+	}
+	return wrapDict(out, samples), nil
+}
+
+// wrapDict wraps content (the COVER-selected dictionary bytes) in a
+// standard zstd dictionary header by handing it to zstd.BuildDict as
+// shared history, along with samples, which BuildDict encodes against that
+// history to derive real Huffman and FSE entropy tables and initial
+// repeat-offsets. The Dictionary_ID is derived deterministically from
+// content (so that Train stays deterministic), avoiding the reserved ID 0.
+//
+// BuildDict needs content and at least one sample of a handful of bytes to
+// produce tables; if it can't (e.g. a too-small corpus), content is
+// returned unmodified, which is still a valid "raw content prefix"
+// dictionary (see raczstd's doc comment), just without a magic number or
+// Dictionary_ID. BuildDict is also known to panic (rather than return an
+// error) on some too-small or degenerate corpora, so that case is
+// recovered from too.
+func wrapDict(content []byte, samples [][]byte) (d []byte) {
+	if len(content) < 8 {
+		return content
+	}
+	defer func() {
+		if recover() != nil {
+			d = content
+		}
+	}()
+	id := crc32.ChecksumIEEE(content)
+	if id == 0 {
+		id = 1 // Dictionary_ID 0 is reserved to mean "no ID".
+	}
+	built, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  content,
+	})
+	if err != nil {
+		return content
+	}
+	return built
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package dict
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// contentSize returns how many of d's bytes are actual dictionary content,
+// as opposed to the standard zstd dictionary header that wrapDict may have
+// prepended: d's InspectDictionary-reported ContentSize if d is a standard,
+// magic-prefixed dictionary, or simply len(d) if wrapDict fell back to
+// returning raw content (see Train's doc comment).
+func contentSize(d []byte) int {
+	if insp, err := zstd.InspectDictionary(d); err == nil {
+		return insp.ContentSize()
+	}
+	return len(d)
+}
+
+func TestTrainNoSamples(t *testing.T) {
+	if _, err := Train(nil, DefaultParams); err != ErrNoSamples {
+		t.Fatalf("Train(nil): got %v, want ErrNoSamples", err)
+	}
+	shortSample := [][]byte{[]byte("short")}
+	if _, err := Train(shortSample, Params{K: 16, D: 8, MaxDictSize: 1024}); err != ErrNoSamples {
+		t.Fatalf("Train(shortSample): got %v, want ErrNoSamples", err)
+	}
+}
+
+func TestTrainInvalidK(t *testing.T) {
+	samples := [][]byte{[]byte(strings.Repeat("x", 32))}
+	if _, err := Train(samples, Params{K: 4, D: 8, MaxDictSize: 1024}); err != ErrInvalidK {
+		t.Fatalf("Train: got %v, want ErrInvalidK", err)
+	}
+}
+
+// TestTrainPrefersSharedSubstrings checks that Train favors a segment
+// repeated across many samples over one that only appears once, which is
+// the whole point of the COVER algorithm's cross-sample dmer scoring.
+func TestTrainPrefersSharedSubstrings(t *testing.T) {
+	shared := "the quick brown fox jumps over"
+	var samples [][]byte
+	for i := 0; i < 8; i++ {
+		samples = append(samples, []byte(shared+strings.Repeat(string(rune('a'+i)), 32)))
+	}
+	samples = append(samples, bytes.Repeat([]byte("z"), 64)) // Present in only one sample.
+
+	got, err := Train(samples, Params{K: 16, D: 8, MaxDictSize: 16})
+	if err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	// The content is the last contentSize bytes, after any standard zstd
+	// dictionary header that wrapDict prepended.
+	content := got[len(got)-contentSize(got):]
+	if !strings.Contains(shared, string(content)) {
+		t.Fatalf("Train: got content %q, want a substring of the shared text %q", content, shared)
+	}
+}
+
+// TestTrainDeterministic checks that Train returns the same result across
+// repeated runs on the same input, as its doc comment promises.
+func TestTrainDeterministic(t *testing.T) {
+	samples := sampleCorpus(20, 512)
+	params := Params{K: 16, D: 8, MaxDictSize: 2048}
+
+	want, err := Train(samples, params)
+	if err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		got, err := Train(samples, params)
+		if err != nil {
+			t.Fatalf("Train (run %d): %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Train (run %d): non-deterministic result", i)
+		}
+	}
+}
+
+// TestTrainRespectsMaxDictSize checks that the returned dictionary's
+// content never exceeds the requested cap, even when the corpus could in
+// principle supply much more shared content. MaxDictSize bounds the
+// COVER-selected content, not any header wrapDict prepends around it, so
+// the check looks past the header (if any) via contentSize.
+func TestTrainRespectsMaxDictSize(t *testing.T) {
+	samples := sampleCorpus(50, 1024)
+	const maxDictSize = 4096
+
+	got, err := Train(samples, Params{K: 16, D: 8, MaxDictSize: maxDictSize})
+	if err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	if n := contentSize(got); n > maxDictSize {
+		t.Fatalf("Train: dictionary content is %d bytes, want at most %d", n, maxDictSize)
+	}
+}
+
+// TestTrainWrapsStandardDictionary checks that, given a corpus rich enough
+// for zstd.BuildDict to synthesize real entropy tables, Train's result is a
+// standard, magic-prefixed dictionary with a non-zero Dictionary_ID rather
+// than the bare-content fallback.
+func TestTrainWrapsStandardDictionary(t *testing.T) {
+	samples := richCorpus(120, 4096)
+	got, err := Train(samples, Params{K: 16, D: 8, MaxDictSize: 4096})
+	if err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+	insp, err := zstd.InspectDictionary(got)
+	if err != nil {
+		t.Fatalf("InspectDictionary: %v (want a standard dictionary for a rich enough corpus)", err)
+	}
+	if insp.ID() == 0 {
+		t.Fatalf("InspectDictionary: ID is 0, want a non-zero Dictionary_ID")
+	}
+	if insp.ContentSize() == 0 {
+		t.Fatalf("InspectDictionary: ContentSize is 0")
+	}
+}
+
+// sampleCorpus deterministically synthesizes n samples of the given length,
+// built from overlapping, repeated fragments so that cross-sample dmers
+// actually exist for COVER to find.
+func sampleCorpus(n int, length int) [][]byte {
+	fragments := []string{
+		"the quick brown fox jumps over the lazy dog. ",
+		"pack my box with five dozen liquor jugs. ",
+		"how vexingly quick daft zebras jump! ",
+	}
+	samples := make([][]byte, n)
+	for i := range samples {
+		var b strings.Builder
+		for b.Len() < length {
+			b.WriteString(fragments[(i+b.Len())%len(fragments)])
+		}
+		samples[i] = []byte(b.String()[:length])
+	}
+	return samples
+}
+
+// richCorpus deterministically synthesizes n samples of the given length
+// from a wider vocabulary than sampleCorpus, so that there's enough
+// sequence variety for zstd.BuildDict to produce real entropy tables
+// (BuildDict needs more to work with than COVER's own tiny test corpora).
+func richCorpus(n int, length int) [][]byte {
+	words := []string{
+		"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog",
+		"random", "access", "compression", "format", "zstd", "dictionary",
+		"training", "segment", "sample", "content", "header", "magic",
+	}
+	samples := make([][]byte, n)
+	for i := range samples {
+		var b strings.Builder
+		for j := 0; b.Len() < length; j++ {
+			b.WriteString(words[(i*7+j)%len(words)])
+			b.WriteByte(' ')
+		}
+		samples[i] = []byte(b.String()[:length])
+	}
+	return samples
+}
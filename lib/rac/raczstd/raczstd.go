@@ -0,0 +1,192 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+// Package raczstd adapts the Zstandard codec for use with RAC (Random
+// Access Compression) files.
+//
+// Every RAC chunk is its own complete zstd frame, so that chunks can be
+// decompressed independently. A shared zstd dictionary (see -resources in
+// the ractool documentation) may be attached to every chunk, in which case
+// the dictionary's bytes are stored once, as a RAC shared resource, and
+// referenced by each chunk rather than being repeated per chunk.
+package raczstd
+
+import (
+	"encoding/binary"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/google/wuffs/lib/rac"
+)
+
+// dictMagic is the magic number that a standard zstd dictionary (complete
+// with Dictionary_ID and entropy tables) starts with. Dictionary bytes that
+// don't start with it are used as a "raw content prefix" dictionary
+// instead: arbitrary bytes used as initial history, with no Dictionary_ID.
+const dictMagic = 0xEC30A437
+
+// isRawContentDict reports whether dict should be treated as a raw content
+// prefix (as opposed to the standard, magic-prefixed dictionary format that
+// zstd.WithEncoderDict / zstd.WithDecoderDicts require).
+func isRawContentDict(dict []byte) bool {
+	return len(dict) < 4 || binary.LittleEndian.Uint32(dict[:4]) != dictMagic
+}
+
+// Writer adapts zstd for use as a rac.CodecWriter. Its zero value is not
+// usable; use NewWriter.
+//
+// A Writer is not safe for concurrent use. A parallel encoder should give
+// each worker goroutine its own Writer (and hence its own reusable hash
+// tables and sequence buffers), mirroring how pure-Go zstd encoders keep
+// that state per instance.
+type Writer struct {
+	enc  *zstd.Encoder
+	dict []byte
+}
+
+// NewWriter returns a Writer. If dict is non-empty, every chunk that this
+// Writer compresses is encoded against dict as a shared zstd dictionary:
+// either via the standard Dictionary_ID mechanism (if dict starts with the
+// zstd dictionary magic number) or, failing that, via the "raw content
+// prefix" mode.
+func NewWriter(dict []byte) (*Writer, error) {
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if len(dict) > 0 {
+		if isRawContentDict(dict) {
+			opts = append(opts, zstd.WithEncoderDictRaw(0, dict))
+		} else {
+			opts = append(opts, zstd.WithEncoderDict(dict))
+		}
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{enc: enc, dict: dict}, nil
+}
+
+// Codec implements rac.CodecWriter.
+func (w *Writer) Codec() rac.Codec { return rac.CodecZstandard }
+
+// Compress implements rac.CodecWriter. Each call produces one complete,
+// independently decodable zstd frame.
+func (w *Writer) Compress(dst []byte, src []byte) ([]byte, error) {
+	return w.enc.EncodeAll(src, dst), nil
+}
+
+// Reset implements rac.CodecWriter.
+func (w *Writer) Reset() {
+	// The underlying zstd.Encoder keeps no per-chunk state once EncodeAll
+	// returns (each call is a complete, independent frame), so there is
+	// nothing to discard here. Reset exists so that callers (e.g. a worker
+	// pool) have a uniform contract across codecs.
+}
+
+// ChunkLength implements an adaptive binary search over the prefix of src
+// to compress, so that the resulting compressed chunk is close to (but not
+// exceeding, when possible) target bytes. This lets -cchunksize pick a
+// decompressed chunk length without knowing the codec's compression ratio
+// in advance.
+//
+// lo and hi give the initial search bracket and should be set to sensible
+// minimum and maximum decompressed chunk lengths (e.g. 1KiB and 4MiB). If a
+// hi-byte prefix still compresses to less than target, hi is doubled (up to
+// len(src)) until it does not, so the result can exceed the hi passed in.
+func (w *Writer) ChunkLength(src []byte, target int, lo int, hi int) int {
+	if hi > len(src) {
+		hi = len(src)
+	}
+	if lo > hi {
+		lo = hi
+	}
+	if hi == 0 {
+		return 0
+	}
+
+	// Expand hi until its compressed size reaches or passes target, or we
+	// run out of src.
+	for hi < len(src) && len(w.enc.EncodeAll(src[:hi], nil)) < target {
+		lo = hi
+		next := hi * 2
+		if next > len(src) {
+			next = len(src)
+		}
+		if next == hi {
+			break
+		}
+		hi = next
+	}
+
+	// Binary search [lo, hi] for the largest prefix whose compressed size
+	// does not exceed target.
+	best := lo
+	for lo <= hi {
+		mid := lo + (hi-lo)/2
+		if mid == 0 {
+			break
+		}
+		cLen := len(w.enc.EncodeAll(src[:mid], nil))
+		if cLen <= target {
+			best = mid
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	if best == 0 && len(src) > 0 {
+		best = 1
+	}
+	return best
+}
+
+// Reader adapts zstd for use as a rac.CodecReader.
+type Reader struct {
+	dec   *zstd.Decoder
+	dicts map[uint64][]byte
+}
+
+// NewReader returns a Reader. Dictionary bytes are supplied later, per
+// STag, via SetResource, since a RAC index lists chunks (and their STags)
+// before the caller has necessarily loaded the corresponding resources.
+func NewReader() (*Reader, error) {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{dec: dec, dicts: map[uint64][]byte{}}, nil
+}
+
+// Codec implements rac.CodecReader.
+func (r *Reader) Codec() rac.Codec { return rac.CodecZstandard }
+
+// SetResource implements rac.CodecReader. The dictionary bytes are recorded
+// once (here) and reused across every chunk that references sTag, so that
+// decompression stays random access. Each Decompress call for such a chunk
+// builds a new zstd decoder from those bytes.
+func (r *Reader) SetResource(sTag uint64, data []byte) {
+	r.dicts[sTag] = data
+}
+
+// Decompress implements rac.CodecReader.
+func (r *Reader) Decompress(dst []byte, src []byte, sTag uint64) ([]byte, error) {
+	if dict, ok := r.dicts[sTag]; ok && len(dict) > 0 {
+		var opt zstd.DOption
+		if isRawContentDict(dict) {
+			opt = zstd.WithDecoderDictRaw(0, dict)
+		} else {
+			opt = zstd.WithDecoderDicts(dict)
+		}
+		dec, err := zstd.NewReader(nil, opt)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return dec.DecodeAll(src, dst)
+	}
+	return r.dec.DecodeAll(src, dst)
+}
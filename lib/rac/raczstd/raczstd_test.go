@@ -0,0 +1,135 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package raczstd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRoundTripNoDict(t *testing.T) {
+	w, err := NewWriter(nil)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	r, err := NewReader()
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+
+	src := []byte("the quick brown fox jumps over the lazy dog")
+	cSrc, err := w.Compress(nil, src)
+	if err != nil {
+		t.Fatalf("Compress: %v", err)
+	}
+	got, err := r.Decompress(nil, cSrc, 0)
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	if !bytes.Equal(got, src) {
+		t.Fatalf("Decompress: got %q, want %q", got, src)
+	}
+}
+
+// TestRoundTripRawContentDict checks the "raw content prefix" path:
+// dictionary bytes with no standard zstd magic number.
+func TestRoundTripRawContentDict(t *testing.T) {
+	dict := bytes.Repeat([]byte("shared dictionary content. "), 64)
+	if !isRawContentDict(dict) {
+		t.Fatalf("test setup: dict unexpectedly looks like a standard dictionary")
+	}
+
+	w, err := NewWriter(dict)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	r, err := NewReader()
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	r.SetResource(1, dict)
+
+	src := []byte("shared dictionary content. and then some chunk-specific text")
+	cSrc, err := w.Compress(nil, src)
+	if err != nil {
+		t.Fatalf("Compress: %v", err)
+	}
+	got, err := r.Decompress(nil, cSrc, 1)
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	if !bytes.Equal(got, src) {
+		t.Fatalf("Decompress: got %q, want %q", got, src)
+	}
+
+	// Decompressing without the dictionary registered should fail or
+	// produce different bytes, confirming the dictionary was load-bearing.
+	if got2, err := r.Decompress(nil, cSrc, 0); err == nil && bytes.Equal(got2, src) {
+		t.Fatalf("Decompress without the dictionary unexpectedly succeeded")
+	}
+}
+
+// TestIsRawContentDict checks that isRawContentDict classifies bytes that
+// start with the standard zstd dictionary magic number as a standard
+// dictionary, and anything else (including nil) as a raw content prefix. It
+// does not encode or decode against a standard dictionary.
+func TestIsRawContentDict(t *testing.T) {
+	magic := []byte{0x37, 0xa4, 0x30, 0xec} // Little-endian 0xEC30A437.
+	if isRawContentDict(magic) {
+		t.Fatalf("isRawContentDict(magic): got true, want false")
+	}
+	if !isRawContentDict([]byte("not a dictionary")) {
+		t.Fatalf("isRawContentDict(plain bytes): got false, want true")
+	}
+	if !isRawContentDict(nil) {
+		t.Fatalf("isRawContentDict(nil): got false, want true")
+	}
+}
+
+// TestChunkLength checks that ChunkLength's adaptive binary search returns a
+// prefix length whose compressed size is close to, but does not exceed
+// (when a shorter prefix can satisfy that), the target.
+func TestChunkLength(t *testing.T) {
+	w, err := NewWriter(nil)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	src := []byte(strings.Repeat("some moderately compressible text. ", 2000))
+
+	for _, target := range []int{64, 256, 1024} {
+		n := w.ChunkLength(src, target, 16, len(src))
+		if n <= 0 || n > len(src) {
+			t.Fatalf("ChunkLength(target=%d): got %d, want in (0, %d]", target, n, len(src))
+		}
+		cLen := len(w.enc.EncodeAll(src[:n], nil))
+		if cLen > target && n > 16 {
+			t.Fatalf("ChunkLength(target=%d): prefix %d compresses to %d bytes, exceeding target", target, n, cLen)
+		}
+		// A longer prefix (if any remains) should compress past target;
+		// otherwise ChunkLength under-selected.
+		if n < len(src) {
+			cLenNext := len(w.enc.EncodeAll(src[:n+1], nil))
+			if cLenNext <= target {
+				t.Fatalf("ChunkLength(target=%d): prefix %d+1 still compresses to %d <= target, so %d was not maximal", target, n, cLenNext, n)
+			}
+		}
+	}
+}
+
+// TestChunkLengthEmpty checks the degenerate case of an empty source.
+func TestChunkLengthEmpty(t *testing.T) {
+	w, err := NewWriter(nil)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if n := w.ChunkLength(nil, 1024, 16, 4096); n != 0 {
+		t.Fatalf("ChunkLength(empty): got %d, want 0", n)
+	}
+}
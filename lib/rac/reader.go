@@ -0,0 +1,90 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"io"
+	"sort"
+)
+
+// CodecReader adapts a specific compression codec so that its chunks can be
+// decompressed by a Reader.
+type CodecReader interface {
+	// Codec returns the RAC codec that this CodecReader implements.
+	Codec() Codec
+
+	// Decompress decompresses src, appending the result to dst and
+	// returning the extended slice. sTag identifies which (if any) shared
+	// resource (as previously passed to SetResource) this chunk uses.
+	Decompress(dst []byte, src []byte, sTag uint64) ([]byte, error)
+
+	// SetResource records the raw bytes of a shared resource (such as a
+	// zstd dictionary), as looked up via its STag, so that later
+	// Decompress calls can use it.
+	SetResource(sTag uint64, data []byte)
+}
+
+// Reader reads decompressed bytes, at an arbitrary offset, out of a RAC
+// file without having to decompress all of the preceding chunks.
+type Reader struct {
+	ReaderAt io.ReaderAt
+	Chunks   []Chunk
+	Codecs   map[Codec]CodecReader
+}
+
+// chunkAt returns the chunk (if any) whose DRange contains dOffset.
+func (r *Reader) chunkAt(dOffset int64) (Chunk, bool) {
+	i := sort.Search(len(r.Chunks), func(i int) bool {
+		return r.Chunks[i].DRange[1] > dOffset
+	})
+	if i >= len(r.Chunks) {
+		return Chunk{}, false
+	}
+	c := r.Chunks[i]
+	if dOffset < c.DRange[0] {
+		return Chunk{}, false
+	}
+	return c, true
+}
+
+// ReadRange returns the decompressed bytes in [dStart, dEnd), decompressing
+// only the chunks that overlap that range.
+func (r *Reader) ReadRange(dStart, dEnd int64) ([]byte, error) {
+	if dStart < 0 || dEnd < dStart {
+		return nil, ErrInvalidRange
+	}
+	out := make([]byte, 0, dEnd-dStart)
+	for dOffset := dStart; dOffset < dEnd; {
+		c, ok := r.chunkAt(dOffset)
+		if !ok {
+			return nil, ErrInvalidIndex
+		}
+		cr, ok := r.Codecs[c.Codec]
+		if !ok {
+			return nil, ErrUnsupportedCodec
+		}
+		cLen := c.CRange[1] - c.CRange[0]
+		src := make([]byte, cLen)
+		if _, err := r.ReaderAt.ReadAt(src, c.CRange[0]); err != nil {
+			return nil, err
+		}
+		full, err := cr.Decompress(nil, src, c.STag)
+		if err != nil {
+			return nil, err
+		}
+		lo := dOffset - c.DRange[0]
+		hi := int64(len(full))
+		if want := dEnd - c.DRange[0]; want < hi {
+			hi = want
+		}
+		out = append(out, full[lo:hi]...)
+		dOffset = c.DRange[0] + hi
+	}
+	return out, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 The Wuffs Authors.
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// https://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or https://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package rac
+
+import (
+	"bytes"
+	"io"
+)
+
+// Writer assembles a sequence of independently compressed chunks, plus the
+// RAC index that maps decompressed-space ranges to compressed-space ranges,
+// into a single RAC file written to an underlying io.Writer.
+//
+// Writer is not safe for concurrent use. Callers that want to compress
+// chunks in parallel should feed their results to a single Writer goroutine
+// in DSpace order, e.g. via a ParallelWriter.
+type Writer struct {
+	// Writer is the underlying io.Writer that the RAC-formatted bytes are
+	// written to.
+	Writer io.Writer
+
+	// IndexLocation says whether the index is written at the start or at
+	// the end of the output. It is ignored when Envelope is set: the
+	// envelope (and the index inside it) is always written at the end.
+	IndexLocation IndexLocation
+
+	// Envelope, if true, wraps the index (and any shared resources) in a
+	// zstd skippable frame appended after the chunk data, instead of
+	// writing them as raw bytes. This keeps the overall output decodable
+	// by a plain "zstd -d" while a RAC-aware reader can still use
+	// ProbeEnvelope to find the index in O(1). It is only meaningful when
+	// every chunk's codec is CodecZstandard.
+	Envelope bool
+
+	// CBiases and DBiases are added to the CStart and CEnd (and DStart and
+	// DEnd) of every chunk recorded in the index.
+	CBiases
+	DBiases
+
+	cOffset              int64
+	dOffset              int64
+	chunks               []Chunk
+	resources            []ResourceEntry
+	envelopeResourceData []byte
+	startBuf             bytes.Buffer
+	nextSTag             uint64
+	finished             bool
+}
+
+// sink returns the io.Writer that chunk and resource bytes are written to.
+// Usually that is w.Writer directly. But an un-Enveloped Writer with
+// IndexLocationAtStart must write the index before any chunk or resource
+// bytes (so that a reader doesn't have to seek to the end to find it), and
+// the index's length isn't known until every chunk has been added. Such
+// bytes are therefore buffered here and only flushed, after the index, by
+// Close.
+func (w *Writer) sink() io.Writer {
+	if !w.Envelope && w.IndexLocation == IndexLocationAtStart {
+		return &w.startBuf
+	}
+	return w.Writer
+}
+
+// AddResource registers a shared resource (such as a zstd dictionary) and
+// returns an STag that later AddChunk calls can use to reference it.
+//
+// In non-Envelope mode, data is written immediately via sink (to the
+// underlying Writer, or, for IndexLocationAtStart, to the buffer that Close
+// flushes after the index). In Envelope mode, data is instead embedded (at Close) inside the
+// trailing skippable frame, so that it doesn't interrupt the concatenation
+// of per-chunk zstd frames that a plain zstd decoder walks.
+func (w *Writer) AddResource(data []byte) (sTag uint64, retErr error) {
+	if w.finished {
+		return 0, errWriterFinished
+	}
+	w.nextSTag++
+	sTag = w.nextSTag
+
+	if w.Envelope {
+		w.resources = append(w.resources, ResourceEntry{STag: sTag, CRange: [2]int64{0, int64(len(data))}})
+		w.envelopeResourceData = append(w.envelopeResourceData, data...)
+		return sTag, nil
+	}
+
+	cStart := w.cOffset
+	n, err := w.sink().Write(data)
+	if err != nil {
+		return 0, err
+	}
+	w.cOffset += int64(n)
+	w.resources = append(w.resources, ResourceEntry{STag: sTag, CRange: [2]int64{cStart, w.cOffset}})
+	return sTag, nil
+}
+
+// AddChunk compresses src with cw and appends the result (and a
+// corresponding index entry) to the RAC file being written. sTag is the
+// value returned by a prior AddResource call, or zero if this chunk does not
+// use a shared resource.
+func (w *Writer) AddChunk(cw CodecWriter, src []byte, sTag uint64) error {
+	if w.finished {
+		return errWriterFinished
+	}
+	dst, err := cw.Compress(nil, src)
+	if err != nil {
+		return err
+	}
+	// Every chunk is independently compressed, so cw is "between unrelated
+	// chunks" again as soon as Compress returns.
+	cw.Reset()
+	n, err := w.sink().Write(dst)
+	if err != nil {
+		return err
+	}
+	return w.recordChunk(cw.Codec(), len(src), n, sTag)
+}
+
+// recordChunk records the index bookkeeping for a chunk whose compressed
+// bytes have already been written directly to w.sink(), e.g. by a
+// ParallelWriter's serializer goroutine.
+func (w *Writer) recordChunk(codec Codec, dLen int, cLen int, sTag uint64) error {
+	if w.finished {
+		return errWriterFinished
+	}
+	dStart, cStart := w.dOffset, w.cOffset
+	w.dOffset += int64(dLen)
+	w.cOffset += int64(cLen)
+	w.chunks = append(w.chunks, Chunk{
+		DRange: [2]int64{dStart, w.dOffset},
+		CRange: [2]int64{cStart, w.cOffset},
+		Codec:  codec,
+		STag:   sTag,
+	})
+	return nil
+}
+
+// Close finishes writing the RAC file, flushing the index.
+func (w *Writer) Close() error {
+	if w.finished {
+		return nil
+	}
+	w.finished = true
+
+	if !w.Envelope {
+		if w.IndexLocation == IndexLocationAtStart {
+			return w.closeIndexAtStart()
+		}
+		return w.closeIndexAtEnd()
+	}
+
+	// In envelope mode, any resource data collected by AddResource is
+	// embedded (right before the index) inside the trailing skippable
+	// frame, and resources are addressed by their offset within that
+	// frame's content rather than within the overall file.
+	resources := make([]ResourceEntry, len(w.resources))
+	resourcePayload := make([]byte, 0, len(w.envelopeResourceData))
+	for i, r := range w.resources {
+		n := r.CRange[1] - r.CRange[0]
+		resources[i] = ResourceEntry{STag: r.STag, CRange: [2]int64{int64(len(resourcePayload)), int64(len(resourcePayload)) + n}}
+		resourcePayload = append(resourcePayload, w.envelopeResourceData[r.CRange[0]:r.CRange[1]]...)
+	}
+	index := buildIndex(resources, w.chunks, w.CBiases, w.DBiases)
+
+	payload := appendUint64(nil, uint64(len(resourcePayload)))
+	payload = append(payload, resourcePayload...)
+	payload = append(payload, index...)
+
+	_, err := w.Writer.Write(EncodeEnvelope(payload))
+	return err
+}
+
+// closeIndexAtEnd writes the index (and its plain footer) directly after the
+// chunk and resource bytes that sink() has already written to w.Writer.
+func (w *Writer) closeIndexAtEnd() error {
+	index := buildIndex(w.resources, w.chunks, w.CBiases, w.DBiases)
+	if _, err := w.Writer.Write(index); err != nil {
+		return err
+	}
+	_, err := w.Writer.Write(encodePlainFooter(len(index), plainMagicAtEnd))
+	return err
+}
+
+// closeIndexAtStart writes the footer and the index first, then the chunk
+// and resource bytes that sink() buffered (in startBuf) instead of writing
+// directly. Every CRange recorded in the index is biased by the length of
+// the footer and index themselves, since those now precede the bytes they
+// describe.
+func (w *Writer) closeIndexAtStart() error {
+	bias := w.CBias + int64(plainFooterLen) + int64(len(buildIndex(w.resources, w.chunks, w.CBiases, w.DBiases)))
+
+	resources := make([]ResourceEntry, len(w.resources))
+	for i, r := range w.resources {
+		resources[i] = ResourceEntry{STag: r.STag, CRange: [2]int64{r.CRange[0] + bias, r.CRange[1] + bias}}
+	}
+	cb := CBiases{CBias: bias}
+	index := buildIndex(resources, w.chunks, cb, w.DBiases)
+
+	if _, err := w.Writer.Write(encodePlainFooter(len(index), plainMagicAtStart)); err != nil {
+		return err
+	}
+	if _, err := w.Writer.Write(index); err != nil {
+		return err
+	}
+	_, err := w.Writer.Write(w.startBuf.Bytes())
+	return err
+}
+
+var errWriterFinished = errValue("rac: Writer is already closed")
+
+type errValue string
+
+func (e errValue) Error() string { return string(e) }